@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// PreserveAttr identifies a source file attribute copyFile should carry over to the destination
+// after copying, selected via the --preserve flag.
+type PreserveAttr string
+
+const (
+	PreserveMode  PreserveAttr = "mode"
+	PreserveMTime PreserveAttr = "mtime"
+	PreserveOwner PreserveAttr = "owner"
+)
+
+// CopyOptions controls how Scanner.copyFile places bytes at the destination.
+type CopyOptions struct {
+	// Preserve lists which source attributes to reapply to the destination after copying.
+	Preserve []PreserveAttr
+	// Hardlink makes copyFile link the destination to the source instead of copying bytes, for
+	// near-zero-cost snapshots. It only applies when SrcFs and DstFs are both the real OS
+	// filesystem and share a device; copyFile silently falls back to a regular copy otherwise.
+	Hardlink bool
+}
+
+func (o CopyOptions) preserves(attr PreserveAttr) bool {
+	for _, a := range o.Preserve {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePreserve splits a comma-separated --preserve flag value ("mode,mtime,owner") into the
+// PreserveAttr values copyFile understands.
+func parsePreserve(spec string) ([]PreserveAttr, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var attrs []PreserveAttr
+	for _, part := range strings.Split(spec, ",") {
+		attr := PreserveAttr(strings.TrimSpace(part))
+		switch attr {
+		case PreserveMode, PreserveMTime, PreserveOwner:
+			attrs = append(attrs, attr)
+		default:
+			return nil, fmt.Errorf("unknown --preserve attribute %q", part)
+		}
+	}
+	return attrs, nil
+}
+
+// copyFile places src's contents (read from SrcFs) at dst on DstFs. Unless Copy.Hardlink
+// succeeds, it writes the bytes to a sibling temp file and renames it into place, so an
+// interrupted run never leaves a half-written file at dst for the next scan's same-size check to
+// mistake as unchanged. Rename is atomic on every platform Go supports, including Windows, where
+// os.Rename already replaces an existing dst via MoveFileEx under the hood.
+func (s *Scanner) copyFile(src, dst string) error {
+	if s.Copy.Hardlink {
+		if linked, err := s.hardlinkFile(src, dst); linked {
+			return err
+		}
+	}
+
+	info, err := s.SrcFs.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat source file '%s': %w", src, err)
+	}
+
+	sourceFile, err := s.SrcFs.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file '%s': %w", src, err)
+	}
+	defer sourceFile.Close()
+
+	tmpPath := tempSibling(dst)
+	tmpFile, err := s.DstFs.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for '%s': %w", dst, err)
+	}
+	defer s.DstFs.Remove(tmpPath) // no-op once renamed into place
+
+	if _, err := io.Copy(tmpFile, sourceFile); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to copy file from '%s' to '%s': %w", src, dst, err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to sync temp file for '%s': %w", dst, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file for '%s': %w", dst, err)
+	}
+
+	if err := s.DstFs.Rename(tmpPath, dst); err != nil {
+		return fmt.Errorf("failed to rename temp file into place for '%s': %w", dst, err)
+	}
+
+	return s.preserveAttrs(dst, info)
+}
+
+// tempSibling returns the atomic-copy temp path for dst: a sibling file so the final Rename
+// stays within one directory (and thus one filesystem/device).
+func tempSibling(dst string) string {
+	return fmt.Sprintf("%s.whatsnew-tmp-%d-%x", dst, os.Getpid(), rand.Int63())
+}
+
+// hardlinkFile attempts to link dst to src's inode instead of copying bytes. Its bool return
+// reports whether linking was attempted at all; when false, the caller should fall back to a
+// regular copy because SrcFs/DstFs aren't both the real OS filesystem. A link attempt that fails
+// (e.g. src and dst are on different devices) also falls back, rather than erroring the scan.
+func (s *Scanner) hardlinkFile(src, dst string) (bool, error) {
+	if _, ok := s.SrcFs.(*afero.OsFs); !ok {
+		return false, nil
+	}
+	if _, ok := s.DstFs.(*afero.OsFs); !ok {
+		return false, nil
+	}
+
+	tmpPath := tempSibling(dst)
+	if err := os.Link(src, tmpPath); err != nil {
+		return false, nil
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		os.Remove(tmpPath)
+		return true, fmt.Errorf("failed to rename hardlink into place for '%s': %w", dst, err)
+	}
+	return true, nil
+}
+
+// preserveAttrs reapplies the source attributes requested via --preserve to dst.
+func (s *Scanner) preserveAttrs(dst string, info os.FileInfo) error {
+	if s.Copy.preserves(PreserveMode) {
+		if err := s.DstFs.Chmod(dst, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to preserve mode for '%s': %w", dst, err)
+		}
+	}
+	if s.Copy.preserves(PreserveMTime) {
+		if err := s.DstFs.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("failed to preserve mtime for '%s': %w", dst, err)
+		}
+	}
+	if s.Copy.preserves(PreserveOwner) {
+		if uid, gid, ok := ownerOf(info); ok {
+			if err := s.DstFs.Chown(dst, uid, gid); err != nil {
+				if errors.Is(err, os.ErrPermission) {
+					// Changing ownership requires privileges a non-root run won't have for
+					// files it doesn't own. That's the common case, not a scan failure: warn
+					// and keep the rest of the copy, the same way rsync does.
+					fmt.Fprintf(os.Stderr, "warning: failed to preserve owner for '%s': %v\n", dst, err)
+				} else {
+					return fmt.Errorf("failed to preserve owner for '%s': %w", dst, err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// chownDeniedFs wraps an afero.Fs and makes Chown always fail with EPERM, simulating a non-root
+// run trying to preserve ownership of a file it doesn't own.
+type chownDeniedFs struct {
+	afero.Fs
+}
+
+func (chownDeniedFs) Chown(name string, uid, gid int) error {
+	return &os.PathError{Op: "chown", Path: name, Err: syscall.EPERM}
+}
+
+func TestCopyFileLeavesNoTempFileBehind(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "a.txt"), []byte("hello"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	entries, err := afero.ReadDir(fs, outputDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "no .whatsnew-tmp-* file should remain once the copy completes")
+	assert.Equal(t, "a.txt", entries[0].Name())
+}
+
+func TestCopyFilePreservesModeAndMTime(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	srcPath := filepath.Join(inputDir, "a.txt")
+	assert.NoError(t, afero.WriteFile(fs, srcPath, []byte("hello"), 0o600))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NoError(t, fs.Chtimes(srcPath, mtime, mtime))
+
+	scanner := newTestScanner(t, fs)
+	scanner.Copy = CopyOptions{Preserve: []PreserveAttr{PreserveMode, PreserveMTime}}
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	info, err := fs.Stat(filepath.Join(outputDir, "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	assert.True(t, mtime.Equal(info.ModTime()), "expected mtime %v, got %v", mtime, info.ModTime())
+}
+
+func TestParsePreserve(t *testing.T) {
+	attrs, err := parsePreserve("mode, mtime")
+	assert.NoError(t, err)
+	assert.Equal(t, []PreserveAttr{PreserveMode, PreserveMTime}, attrs)
+
+	attrs, err = parsePreserve("")
+	assert.NoError(t, err)
+	assert.Nil(t, attrs)
+
+	_, err = parsePreserve("mode,bogus")
+	assert.Error(t, err)
+}
+
+// fakeOwnedFileInfo wraps an os.FileInfo and reports a real *syscall.Stat_t from Sys(), so
+// ownerOf() (which MemMapFs's always-nil Sys() can't exercise) has owner data to preserve.
+type fakeOwnedFileInfo struct {
+	os.FileInfo
+}
+
+func (fakeOwnedFileInfo) Sys() interface{} { return &syscall.Stat_t{Uid: 0, Gid: 0} }
+
+func TestPreserveAttrsWarnsAndContinuesWhenOwnerPreservationDenied(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	path := "/output/a.txt"
+	assert.NoError(t, afero.WriteFile(fs, path, []byte("hello"), 0o644))
+	info, err := fs.Stat(path)
+	assert.NoError(t, err)
+
+	scanner := newTestScanner(t, fs)
+	scanner.DstFs = chownDeniedFs{fs}
+	scanner.Copy = CopyOptions{Preserve: []PreserveAttr{PreserveOwner}}
+
+	// EPERM from Chown must not fail the copy; it should only warn.
+	assert.NoError(t, scanner.preserveAttrs(path, fakeOwnedFileInfo{info}))
+}
+
+func TestHardlinkFallsBackToCopyOffRealFilesystem(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "a.txt"), []byte("hello"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	scanner.Copy = CopyOptions{Hardlink: true}
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	data, err := afero.ReadFile(fs, filepath.Join(outputDir, "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// generationMarker is appended to an inputPrefix to build the sentinel key that stores the
+// last-used scan generation for that prefix. A NUL byte keeps it from colliding with any real
+// relative path, which can't contain one.
+const generationMarker = "\x00generation"
+
+// inputPrefix returns the stable Badger key prefix for entries scanned under inputDir, so a
+// sweep for that directory can use a prefix iterator instead of scanning the whole database.
+func inputPrefix(inputDir string) []byte {
+	sum := sha256.Sum256([]byte(inputDir))
+	return []byte(hex.EncodeToString(sum[:8]) + "/")
+}
+
+// dbKey builds the Badger key for a file found under inputDir at path.
+func dbKey(inputDir, path string) ([]byte, error) {
+	relPath, err := filepath.Rel(inputDir, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relative path for file '%s': %w", path, err)
+	}
+	return append(inputPrefix(inputDir), []byte(relPath)...), nil
+}
+
+// generationKey is the sentinel entry, inside inputDir's own key prefix, that stores the last
+// scan generation used for that directory.
+func generationKey(inputDir string) []byte {
+	return append(inputPrefix(inputDir), []byte(generationMarker)...)
+}
+
+// isFileEntryKey reports whether key, found under prefix, names a scanned file rather than a
+// sentinel entry (generationKey, rollupKey, ...). Every sentinel's own suffix starts with the NUL
+// byte that generationMarker and rollupMarker share, which a real relative path can't contain.
+func isFileEntryKey(key, prefix []byte) bool {
+	suffix := key[len(prefix):]
+	return len(suffix) == 0 || suffix[0] != 0
+}
+
+// loadGeneration returns the last scan generation recorded for inputDir, or 0 if none has run yet.
+func loadGeneration(db *badger.DB, inputDir string) (uint64, error) {
+	var gen uint64
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(generationKey(inputDir))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			gen = binary.LittleEndian.Uint64(val)
+			return nil
+		})
+	})
+	return gen, err
+}
+
+// storeGeneration persists gen as the last scan generation for inputDir.
+func storeGeneration(txn *badger.Txn, inputDir string, gen uint64) error {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, gen)
+	return txn.Set(generationKey(inputDir), buf)
+}
+
+// sweepDeleted walks the Badger entries under inputDir's prefix in one pass and reports any
+// entry whose recorded generation is older than currentGen as deleted, since scanAndCompare
+// would have refreshed it to currentGen had the file still existed. Under mirror, the matching
+// file is also removed from DstFs (unless dryRun) and the entry is deleted from DB.
+func (s *Scanner) sweepDeleted(inputDir, outputDir string, currentGen uint64, mirror, dryRun bool) error {
+	prefix := inputPrefix(inputDir)
+
+	type stale struct {
+		key []byte
+		fp  FileFingerprint
+	}
+
+	var staleEntries []stale
+	err := s.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			if !isFileEntryKey(key, prefix) {
+				continue
+			}
+
+			var fp FileFingerprint
+			if err := item.Value(func(val []byte) error {
+				return fp.UnmarshalBinary(val)
+			}); err != nil {
+				// Same tolerance as processFile: the DB is derivable cache state, and this entry
+				// can belong to a file that's already gone, so no worker will ever revisit it to
+				// repair the value. Skip it rather than failing the whole sweep.
+				continue
+			}
+			if fp.Gen < currentGen {
+				staleEntries = append(staleEntries, stale{key: key, fp: fp})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sweep deleted entries for '%s': %w", inputDir, err)
+	}
+
+	for _, entry := range staleEntries {
+		relPath := string(entry.key[len(prefix):])
+		path := filepath.Join(inputDir, relPath)
+		fmt.Println("Deleted:", path)
+		s.Manifest.Record(newManifestEntry(ManifestDeleted, path, entry.fp))
+
+		if !mirror || dryRun {
+			continue
+		}
+
+		destPath := filepath.Join(outputDir, relPath)
+		if err := s.DstFs.Remove(destPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove deleted file '%s': %w", destPath, err)
+		}
+
+		if err := s.DB.Update(func(txn *badger.Txn) error {
+			return txn.Delete(entry.key)
+		}); err != nil {
+			return fmt.Errorf("failed to delete database entry for '%s': %w", path, err)
+		}
+	}
+
+	return nil
+}
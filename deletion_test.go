@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestScanner(t *testing.T, fs afero.Fs) *Scanner {
+	dbDir := t.TempDir()
+	opts := badger.DefaultOptions(filepath.Join(dbDir, "test.db"))
+	opts.Logger = nil
+	db, err := badger.Open(opts)
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return &Scanner{SrcFs: fs, DstFs: fs, DB: db}
+}
+
+func TestSweepDeletedReportsWithoutMirror(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "keep.txt"), []byte("a"), 0o644))
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "gone.txt"), []byte("b"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	assert.NoError(t, fs.Remove(filepath.Join(inputDir, "gone.txt")))
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	// Without --mirror, the deleted file's copy and database entry are left alone.
+	exists, err := afero.Exists(fs, filepath.Join(outputDir, "gone.txt"))
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestSweepDeletedRemovesUnderMirror(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "keep.txt"), []byte("a"), 0o644))
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "gone.txt"), []byte("b"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	assert.NoError(t, fs.Remove(filepath.Join(inputDir, "gone.txt")))
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, true, SizeOnly{}, 2))
+
+	goneExists, err := afero.Exists(fs, filepath.Join(outputDir, "gone.txt"))
+	assert.NoError(t, err)
+	assert.False(t, goneExists, "mirror should remove the deleted file's copy")
+
+	keepExists, err := afero.Exists(fs, filepath.Join(outputDir, "keep.txt"))
+	assert.NoError(t, err)
+	assert.True(t, keepExists, "mirror should not touch files that still exist")
+
+	err = scanner.DB.View(func(txn *badger.Txn) error {
+		key, err := dbKey(inputDir, filepath.Join(inputDir, "gone.txt"))
+		if err != nil {
+			return err
+		}
+		_, err = txn.Get(key)
+		return err
+	})
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound, "mirror should delete the database entry")
+}
+
+func TestSweepDeletedDryRunLeavesDatabaseEntryIntact(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "gone.txt"), []byte("b"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+	assert.NoError(t, fs.Remove(filepath.Join(inputDir, "gone.txt")))
+
+	// A dry-run mirror must report the deletion without touching DstFs or DB...
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, true, true, SizeOnly{}, 2))
+
+	key, err := dbKey(inputDir, filepath.Join(inputDir, "gone.txt"))
+	assert.NoError(t, err)
+	err = scanner.DB.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		return err
+	})
+	assert.NoError(t, err, "a dry run must not delete the database entry")
+
+	// ...so a subsequent real mirror run still sees and removes it.
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, true, SizeOnly{}, 2))
+	err = scanner.DB.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		return err
+	})
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound, "the real mirror run following a dry run should still delete the entry")
+}
+
+func TestSweepDeletedSkipsUndecodableEntry(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "keep.txt"), []byte("a"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	// Simulate a corrupt/baseline entry for a file that's since been deleted: no worker will ever
+	// revisit this key to repair it, since its file no longer exists to be scanned.
+	goneKey, err := dbKey(inputDir, filepath.Join(inputDir, "gone.txt"))
+	assert.NoError(t, err)
+	assert.NoError(t, scanner.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(goneKey, []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	}))
+
+	// Sweeping must not fail the scan over the undecodable entry.
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, true, SizeOnly{}, 2))
+
+	keepExists, err := afero.Exists(fs, filepath.Join(outputDir, "keep.txt"))
+	assert.NoError(t, err)
+	assert.True(t, keepExists, "an unrelated undecodable entry must not abort the whole sweep")
+}
+
+func TestHandleExistingFileRefreshesGenerationWhenUnchanged(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "stable.txt"), []byte("same"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, true, SizeOnly{}, 2))
+
+	// An unchanged file scanned on every run must never be swept as deleted.
+	exists, err := afero.Exists(fs, filepath.Join(outputDir, "stable.txt"))
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewChangeDetector(t *testing.T) {
+	tests := []struct {
+		name    string
+		detect  string
+		want    Algo
+		wantErr bool
+	}{
+		{name: "default size", detect: "", want: AlgoSize},
+		{name: "size", detect: "size", want: AlgoSize},
+		{name: "mtime", detect: "mtime", want: AlgoMTime},
+		{name: "sha256", detect: "sha256", want: AlgoSHA256},
+		{name: "xxhash", detect: "xxhash", want: AlgoXXHash},
+		{name: "blake3", detect: "blake3", want: AlgoBlake3},
+		{name: "unknown", detect: "md5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newChangeDetector(tt.detect)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, d.Name())
+		})
+	}
+}
+
+func TestDigestDetectorDetectsSameSizeEdit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("aaaa"), 0o644))
+
+	detector, err := newChangeDetector("sha256")
+	assert.NoError(t, err)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	before, err := detector.Fingerprint(afero.NewOsFs(), path, info)
+	assert.NoError(t, err)
+
+	// Same size, different content, same mtime as far as SizeOnly cares.
+	assert.NoError(t, os.WriteFile(path, []byte("bbbb"), 0o644))
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	after, err := detector.Fingerprint(afero.NewOsFs(), path, info)
+	assert.NoError(t, err)
+
+	assert.True(t, detector.Changed(before, after), "expected content hash to detect same-size edit")
+	assert.False(t, SizeOnly{}.Changed(
+		FileFingerprint{Size: before.Size},
+		FileFingerprint{Size: after.Size},
+	), "SizeOnly should not notice a same-size edit")
+}
+
+func TestSizeAndMTimeDetectsTouch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("aaaa"), 0o644))
+
+	detector := SizeAndMTime{}
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	before, err := detector.Fingerprint(afero.NewOsFs(), path, info)
+	assert.NoError(t, err)
+
+	newTime := info.ModTime().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(path, newTime, newTime))
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	after, err := detector.Fingerprint(afero.NewOsFs(), path, info)
+	assert.NoError(t, err)
+
+	assert.True(t, detector.Changed(before, after))
+}
+
+func TestFingerprintRoundTrip(t *testing.T) {
+	fp := FileFingerprint{Size: 42, ModTime: 123, Digest: []byte{1, 2, 3}, Algo: AlgoSHA256}
+
+	data, err := fp.MarshalBinary()
+	assert.NoError(t, err)
+
+	var got FileFingerprint
+	assert.NoError(t, got.UnmarshalBinary(data))
+	assert.Equal(t, fp, got)
+}
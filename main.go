@@ -1,37 +1,50 @@
 package main
 
 import (
-	"encoding/binary"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/dgraph-io/badger/v4"
+	"github.com/spf13/afero"
 )
 
+// progressInterval is how often --progress redraws its stderr counter.
+const progressInterval = 500 * time.Millisecond
+
 type CLI struct {
-	Input  string `short:"i" required:"" help:"Directory to scan"`
-	Output string `short:"o" required:"" help:"Directory to copy new files to"`
-	Write  bool   `short:"w" help:"Update the Badger database"`
-	DryRun bool   `short:"d" help:"Perform a dry run without making any changes"`
-	DBPath string `default:"." help:"Directory to store the Badger database"`
+	Input          string `short:"i" required:"" help:"Directory to scan"`
+	Output         string `short:"o" required:"" help:"Directory to copy new files to"`
+	Write          bool   `short:"w" help:"Update the Badger database"`
+	DryRun         bool   `short:"d" help:"Perform a dry run without making any changes"`
+	DBPath         string `default:"." help:"Directory to store the Badger database"`
+	Detect         string `default:"size" enum:"size,mtime,sha256,xxhash,blake3" help:"Change detection algorithm: size, mtime, sha256, xxhash, or blake3"`
+	Workers        int    `default:"4" help:"Number of concurrent workers used to fingerprint files"`
+	Mirror         bool   `help:"Remove files and database entries that no longer exist in the input directory"`
+	Manifest       string `help:"Write a manifest of New/Updated/Deleted entries from this run to this path"`
+	ManifestFormat string `default:"json" enum:"json,ndjson,txtar" help:"Manifest format: json, ndjson, or txtar"`
+	Progress       bool   `help:"Render a live files-scanned/bytes-copied/ETA counter to stderr"`
+	Preserve       string `help:"Comma-separated source attributes to carry over to copies: mode,mtime,owner"`
+	Hardlink       bool   `help:"Hard-link copies to the source instead of copying bytes when they share a filesystem"`
 }
 
 func main() {
 	var cli CLI
 	kong.Parse(&cli)
 
-	err := processDirectories(cli.Input, cli.Output, cli.DBPath, cli.Write, cli.DryRun)
+	err := processDirectories(afero.NewOsFs(), afero.NewOsFs(), cli.Input, cli.Output, cli.DBPath, cli.Write, cli.DryRun, cli.Mirror, cli.Detect, cli.Workers, cli.Manifest, cli.ManifestFormat, cli.Progress, cli.Preserve, cli.Hardlink)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-// processDirectories handles the main logic of validating paths, scanning directories, and updating the database
-func processDirectories(inputDir, outputDir, dbPath string, writeFlag, dryRun bool) error {
+// processDirectories handles the main logic of validating paths, scanning directories, and updating the
+// database. srcFs and dstFs back the input and output directories respectively; Badger's own storage is
+// left on the real filesystem, since Badger has no afero equivalent.
+func processDirectories(srcFs, dstFs afero.Fs, inputDir, outputDir, dbPath string, writeFlag, dryRun, mirror bool, detect string, workers int, manifestPath, manifestFormat string, progress bool, preserve string, hardlink bool) error {
 	var err error
 	// Validate and sanitize input paths (Abs calls Clean internally)
 	inputDir, err = filepath.Abs(inputDir)
@@ -49,7 +62,7 @@ func processDirectories(inputDir, outputDir, dbPath string, writeFlag, dryRun bo
 
 	if !dryRun {
 		// Create output directory if it doesn't exist
-		err = os.MkdirAll(outputDir, os.ModePerm)
+		err = dstFs.MkdirAll(outputDir, os.ModePerm)
 		if err != nil {
 			return fmt.Errorf("failed to create output directory '%s': %w", outputDir, err)
 		}
@@ -86,12 +99,53 @@ func processDirectories(inputDir, outputDir, dbPath string, writeFlag, dryRun bo
 		}
 	}
 
+	detector, err := newChangeDetector(detect)
+	if err != nil {
+		return err
+	}
+
+	preserveAttrs, err := parsePreserve(preserve)
+	if err != nil {
+		return err
+	}
+
+	var manifest *ManifestWriter
+	if manifestPath != "" {
+		manifest = NewManifestWriter(ManifestFormat(manifestFormat), srcFs)
+	}
+
+	var reporter *ProgressReporter
+	if progress {
+		total, err := countFiles(srcFs, inputDir)
+		if err != nil {
+			return fmt.Errorf("failed to estimate file count for '%s': %w", inputDir, err)
+		}
+		reporter = NewProgressReporter(total, progressInterval)
+		reporter.Start()
+		defer reporter.Stop()
+	}
+
 	// Scan the input directory and compare/store files
-	err = scanAndCompare(db, inputDir, outputDir, writeFlag, dryRun)
+	scanner := &Scanner{
+		SrcFs:    srcFs,
+		DstFs:    dstFs,
+		DB:       db,
+		Manifest: manifest,
+		Progress: reporter,
+		Copy:     CopyOptions{Preserve: preserveAttrs, Hardlink: hardlink},
+	}
+	err = scanner.scanAndCompare(inputDir, outputDir, writeFlag, dryRun, mirror, detector, workers)
 	if err != nil {
 		return err
 	}
 
+	if manifestPath != "" {
+		if err := manifest.WriteTo(dstFs, manifestPath); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote manifest to file: %s\n", manifestPath)
+	}
+
 	if writeFlag {
 		if err = db.Sync(); err != nil {
 			return fmt.Errorf("failed to sync database: %w", err)
@@ -114,110 +168,3 @@ func processDirectories(inputDir, outputDir, dbPath string, writeFlag, dryRun bo
 
 	return nil
 }
-
-// scanAndCompare scans the input directory, compares with the database, and stores new entries
-func scanAndCompare(db *badger.DB, inputDir, outputDir string, writeFlag, dryRun bool) error {
-	return filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		return db.Update(func(txn *badger.Txn) error {
-			item, err := txn.Get([]byte(path))
-			if err == badger.ErrKeyNotFound {
-				return handleNewFile(txn, path, info, inputDir, outputDir, writeFlag, dryRun)
-			} else if err == nil {
-				return handleExistingFile(txn, item, path, info, inputDir, outputDir, writeFlag, dryRun)
-			}
-			return err
-		})
-	})
-}
-
-// handleNewFile processes a new file found during the scan
-func handleNewFile(txn *badger.Txn, path string, info os.FileInfo, inputDir, outputDir string, writeFlag, dryRun bool) error {
-	fmt.Println("New:", path)
-	if writeFlag {
-		if err := txn.Set([]byte(path), int64ToBytes(info.Size())); err != nil {
-			return fmt.Errorf("failed to store file '%s' in database: %w", path, err)
-		}
-	}
-	if dryRun {
-		return nil
-	}
-	return copyFileToOutput(path, inputDir, outputDir)
-}
-
-// handleExistingFile processes an existing file found during the scan
-func handleExistingFile(txn *badger.Txn, item *badger.Item, path string, info os.FileInfo, inputDir, outputDir string, writeFlag, dryRun bool) error {
-	var storedSize int64
-	if err := item.Value(func(val []byte) error {
-		storedSize = bytesToInt64(val)
-		return nil
-	}); err != nil {
-		return err
-	}
-
-	if storedSize != info.Size() {
-		fmt.Println("Updated:", path)
-		if writeFlag {
-			if err := txn.Set([]byte(path), int64ToBytes(info.Size())); err != nil {
-				return fmt.Errorf("failed to update file '%s' in database: %w", path, err)
-			}
-		}
-		if dryRun {
-			return nil
-		}
-		return copyFileToOutput(path, inputDir, outputDir)
-	}
-	return nil
-}
-
-// int64ToBytes converts an int64 to a byte slice
-func int64ToBytes(num int64) []byte {
-	buf := make([]byte, 8)
-	binary.LittleEndian.PutUint64(buf, uint64(num))
-	return buf
-}
-
-func bytesToInt64(buf []byte) int64 {
-	return int64(binary.LittleEndian.Uint64(buf))
-}
-
-// copyFileToOutput copies a file from the input directory to the output directory
-func copyFileToOutput(path, inputDir, outputDir string) error {
-	relPath, err := filepath.Rel(inputDir, path)
-	if err != nil {
-		return fmt.Errorf("failed to get relative path for file '%s': %w", path, err)
-	}
-	destPath := filepath.Join(outputDir, relPath)
-	if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create output directory for file '%s': %w", path, err)
-	}
-	return copyFile(path, destPath)
-}
-
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return fmt.Errorf("failed to open source file '%s': %w", src, err)
-	}
-	defer sourceFile.Close()
-
-	destinationFile, err := os.Create(dst)
-	if err != nil {
-		return fmt.Errorf("failed to create destination file '%s': %w", dst, err)
-	}
-	defer destinationFile.Close()
-
-	_, err = io.Copy(destinationFile, sourceFile)
-	if err != nil {
-		return fmt.Errorf("failed to copy file from '%s' to '%s': %w", src, dst, err)
-	}
-	return err
-}
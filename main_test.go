@@ -3,25 +3,23 @@ package main
 import (
 	"encoding/binary"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strconv"
 	"testing"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestProcessDirectories(t *testing.T) {
-	// Create temporary directories for input, output, and database
-	inputDir := t.TempDir()
-	outputDir := t.TempDir()
+	fs := afero.NewMemMapFs()
+	inputDir := "/input"
+	outputDir := "/output"
 	dbDir := t.TempDir()
 
 	// Create a temporary file in the input directory
-	tempFile, err := os.Create(filepath.Join(inputDir, "testfile.txt"))
-	assert.NoError(t, err, "Failed to create temporary file")
-	tempFile.Close()
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "testfile.txt"), []byte("hello"), 0o644))
 
 	// Test cases
 	tests := []struct {
@@ -60,7 +58,7 @@ func TestProcessDirectories(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := processDirectories(tt.inputDir, tt.outputDir, tt.dbPath, tt.writeFlag, false)
+			err := processDirectories(fs, fs, tt.inputDir, tt.outputDir, tt.dbPath, tt.writeFlag, false, false, "size", 4, "", "json", false, "", false)
 			if tt.wantErr {
 				assert.Error(t, err, "Expected an error but got none")
 			} else {
@@ -69,22 +67,22 @@ func TestProcessDirectories(t *testing.T) {
 
 			// Verify that the file was copied to the output directory if no error was expected
 			if !tt.wantErr && tt.writeFlag {
-				_, err := os.Stat(filepath.Join(tt.outputDir, "testfile.txt"))
-				assert.NoError(t, err, "Expected file to be copied to output directory, but it was not")
+				exists, err := afero.Exists(fs, filepath.Join(tt.outputDir, "testfile.txt"))
+				assert.NoError(t, err)
+				assert.True(t, exists, "Expected file to be copied to output directory, but it was not")
 			}
 		})
 	}
 }
+
 func TestScanAndCompare(t *testing.T) {
-	// Create temporary directories for input, output, and database
-	inputDir := t.TempDir()
-	outputDir := t.TempDir()
+	fs := afero.NewMemMapFs()
+	inputDir := "/input"
+	outputDir := "/output"
 	dbDir := t.TempDir()
 
 	// Create a temporary file in the input directory
-	tempFile, err := os.Create(filepath.Join(inputDir, "testfile.txt"))
-	assert.NoError(t, err, "Failed to create temporary file")
-	tempFile.Close()
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "testfile.txt"), []byte("hello"), 0o644))
 
 	// Open Badger database
 	dbName := filepath.Join(dbDir, "test.db")
@@ -94,6 +92,8 @@ func TestScanAndCompare(t *testing.T) {
 	assert.NoError(t, err, "Failed to open Badger database")
 	defer db.Close()
 
+	scanner := &Scanner{SrcFs: fs, DstFs: fs, DB: db}
+
 	// Test cases
 	tests := []struct {
 		name      string
@@ -131,7 +131,7 @@ func TestScanAndCompare(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := scanAndCompare(db, tt.inputDir, tt.outputDir, tt.writeFlag, tt.dryRun)
+			err := scanner.scanAndCompare(tt.inputDir, tt.outputDir, tt.writeFlag, tt.dryRun, false, SizeOnly{}, 4)
 			if tt.wantErr {
 				assert.Error(t, err, "Expected an error but got none")
 			} else {
@@ -140,8 +140,9 @@ func TestScanAndCompare(t *testing.T) {
 
 			// Verify that the file was copied to the output directory if no error was expected and not a dry run
 			if !tt.wantErr && tt.writeFlag && !tt.dryRun {
-				_, err := os.Stat(filepath.Join(tt.outputDir, "testfile.txt"))
-				assert.NoError(t, err, "Expected file to be copied to output directory, but it was not")
+				exists, err := afero.Exists(fs, filepath.Join(tt.outputDir, "testfile.txt"))
+				assert.NoError(t, err)
+				assert.True(t, exists, "Expected file to be copied to output directory, but it was not")
 			}
 		})
 	}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/rogpeppe/go-internal/txtar"
+	"github.com/spf13/afero"
+)
+
+// ManifestFormat selects how a ManifestWriter serializes its entries to the --manifest file.
+type ManifestFormat string
+
+const (
+	ManifestJSON   ManifestFormat = "json"
+	ManifestNDJSON ManifestFormat = "ndjson"
+	ManifestTxtar  ManifestFormat = "txtar"
+)
+
+// ManifestKind is the kind of change a ManifestEntry records.
+type ManifestKind string
+
+const (
+	ManifestNew     ManifestKind = "new"
+	ManifestUpdated ManifestKind = "updated"
+	ManifestDeleted ManifestKind = "deleted"
+)
+
+// ManifestEntry is one record in a --manifest file, describing what scanAndCompare observed for
+// a single path during a single run.
+type ManifestEntry struct {
+	Path    string       `json:"path"`
+	Kind    ManifestKind `json:"kind"`
+	Size    int64        `json:"size"`
+	ModTime int64        `json:"mtime"`
+	Digest  string       `json:"digest,omitempty"`
+	Algo    Algo         `json:"algo,omitempty"`
+}
+
+// newManifestEntry builds the manifest record for path given the fingerprint observed for it.
+func newManifestEntry(kind ManifestKind, path string, fp FileFingerprint) ManifestEntry {
+	e := ManifestEntry{Path: path, Kind: kind, Size: fp.Size, ModTime: fp.ModTime, Algo: fp.Algo}
+	if len(fp.Digest) > 0 {
+		e.Digest = hex.EncodeToString(fp.Digest)
+	}
+	return e
+}
+
+// ManifestWriter accumulates ManifestEntry records during a scan and serializes them to the
+// --manifest path once the scan completes. A nil *ManifestWriter is valid and records nothing,
+// so callers can pass it around unconditionally when --manifest was not given.
+type ManifestWriter struct {
+	format  ManifestFormat
+	srcFs   afero.Fs
+	mu      sync.Mutex
+	entries []ManifestEntry
+}
+
+// NewManifestWriter returns a ManifestWriter that reads changed file contents (for txtar) from
+// srcFs.
+func NewManifestWriter(format ManifestFormat, srcFs afero.Fs) *ManifestWriter {
+	return &ManifestWriter{format: format, srcFs: srcFs}
+}
+
+// Record appends e to the manifest. It is a no-op on a nil *ManifestWriter, and safe to call
+// concurrently from scanAndCompare's worker pool.
+func (m *ManifestWriter) Record(e ManifestEntry) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, e)
+}
+
+// WriteTo serializes the accumulated entries to path on dstFs. It is a no-op on a nil
+// *ManifestWriter.
+func (m *ManifestWriter) WriteTo(dstFs afero.Fs, path string) error {
+	if m == nil {
+		return nil
+	}
+	switch m.format {
+	case ManifestNDJSON:
+		return m.writeNDJSON(dstFs, path)
+	case ManifestTxtar:
+		return m.writeTxtar(dstFs, path)
+	default:
+		return m.writeJSON(dstFs, path)
+	}
+}
+
+func (m *ManifestWriter) writeJSON(dstFs afero.Fs, path string) error {
+	data, err := json.MarshalIndent(m.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := afero.WriteFile(dstFs, path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest '%s': %w", path, err)
+	}
+	return nil
+}
+
+func (m *ManifestWriter) writeNDJSON(dstFs afero.Fs, path string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range m.entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to encode manifest entry '%s': %w", e.Path, err)
+		}
+	}
+	if err := afero.WriteFile(dstFs, path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest '%s': %w", path, err)
+	}
+	return nil
+}
+
+// writeTxtar packages the manifest index alongside the actual bytes of every new or updated
+// file into a single txtar archive, convenient for shipping a delta over email/chat or feeding
+// to downstream tools without touching outputDir.
+func (m *ManifestWriter) writeTxtar(dstFs afero.Fs, path string) error {
+	index, err := json.MarshalIndent(m.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest index: %w", err)
+	}
+
+	archive := &txtar.Archive{
+		Files: []txtar.File{{Name: "manifest.json", Data: index}},
+	}
+
+	for _, e := range m.entries {
+		if e.Kind == ManifestDeleted {
+			continue
+		}
+		data, err := afero.ReadFile(m.srcFs, e.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s' for manifest archive: %w", e.Path, err)
+		}
+		archive.Files = append(archive.Files, txtar.File{Name: e.Path, Data: data})
+	}
+
+	if err := afero.WriteFile(dstFs, path, txtar.Format(archive), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest '%s': %w", path, err)
+	}
+	return nil
+}
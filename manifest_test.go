@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/go-internal/txtar"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestWriterJSON(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "a.txt"), []byte("hello"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	scanner.Manifest = NewManifestWriter(ManifestJSON, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	manifestPath := "/manifest.json"
+	assert.NoError(t, scanner.Manifest.WriteTo(fs, manifestPath))
+
+	data, err := afero.ReadFile(fs, manifestPath)
+	assert.NoError(t, err)
+
+	var entries []ManifestEntry
+	assert.NoError(t, json.Unmarshal(data, &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, ManifestNew, entries[0].Kind)
+	assert.Equal(t, filepath.Join(inputDir, "a.txt"), entries[0].Path)
+}
+
+func TestManifestWriterNDJSON(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "a.txt"), []byte("hello"), 0o644))
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "b.txt"), []byte("world"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	scanner.Manifest = NewManifestWriter(ManifestNDJSON, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	manifestPath := "/manifest.ndjson"
+	assert.NoError(t, scanner.Manifest.WriteTo(fs, manifestPath))
+
+	data, err := afero.ReadFile(fs, manifestPath)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		var e ManifestEntry
+		assert.NoError(t, json.Unmarshal([]byte(line), &e))
+	}
+}
+
+func TestManifestWriterTxtarBundlesChangedFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "a.txt"), []byte("hello"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	scanner.Manifest = NewManifestWriter(ManifestTxtar, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	manifestPath := "/manifest.txtar"
+	assert.NoError(t, scanner.Manifest.WriteTo(fs, manifestPath))
+
+	data, err := afero.ReadFile(fs, manifestPath)
+	assert.NoError(t, err)
+
+	archive := txtar.Parse(data)
+	assert.Len(t, archive.Files, 2)
+	assert.Equal(t, "manifest.json", archive.Files[0].Name)
+	assert.Equal(t, filepath.Join(inputDir, "a.txt"), archive.Files[1].Name)
+	assert.Equal(t, []byte("hello\n"), archive.Files[1].Data)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// ownerOf always reports ok=false on Windows: os.FileInfo.Sys() doesn't expose a POSIX uid/gid
+// there, so --preserve=owner is a no-op on this platform.
+func ownerOf(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/afero"
+)
+
+// ProgressReporter renders a live files-scanned / bytes-copied / ETA counter to stderr while a
+// scan runs. A nil *ProgressReporter is valid and records nothing, so callers can pass it around
+// unconditionally when --progress was not given.
+type ProgressReporter struct {
+	total   int64 // estimated file count to scan, 0 if unknown
+	scanned int64
+	copied  int64
+	bytes   int64
+
+	start    time.Time
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewProgressReporter returns a ProgressReporter that renders to stderr every interval. total is
+// the estimated number of files the scan will visit, used only to project an ETA; pass 0 if it
+// isn't known ahead of time.
+func NewProgressReporter(total int64, interval time.Duration) *ProgressReporter {
+	return &ProgressReporter{
+		total:    total,
+		start:    time.Now(),
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (p *ProgressReporter) addScanned(n int64) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.scanned, n)
+}
+
+func (p *ProgressReporter) addCopied(size int64) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.copied, 1)
+	atomic.AddInt64(&p.bytes, size)
+}
+
+// Start begins rendering to stderr every p.interval until Stop is called. It is a no-op on a nil
+// *ProgressReporter.
+func (p *ProgressReporter) Start() {
+	if p == nil {
+		return
+	}
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.render()
+			case <-p.stop:
+				p.render()
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts rendering, printing one final line, and blocks until the render goroutine has
+// returned. It is a no-op on a nil *ProgressReporter.
+func (p *ProgressReporter) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	fmt.Fprintln(os.Stderr)
+}
+
+func (p *ProgressReporter) render() {
+	scanned := atomic.LoadInt64(&p.scanned)
+	copied := atomic.LoadInt64(&p.copied)
+	bytesCopied := atomic.LoadInt64(&p.bytes)
+	elapsed := time.Since(p.start)
+
+	eta := "?"
+	if p.total > 0 && scanned > 0 {
+		remaining := p.total - scanned
+		if remaining < 0 {
+			remaining = 0
+		}
+		if rate := float64(scanned) / elapsed.Seconds(); rate > 0 {
+			eta = time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second).String()
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\rscanned %d files, copied %d files (%s), elapsed %s, ETA %s   ",
+		scanned, copied, humanize.Bytes(uint64(bytesCopied)), elapsed.Round(time.Second), eta)
+}
+
+// countFiles returns the number of regular files under dir on fs with a cheap stat-only walk, used
+// to seed a ProgressReporter's ETA estimate before the real (and costlier) scan begins.
+func countFiles(fs afero.Fs, dir string) (int64, error) {
+	var n int64
+	err := afero.Walk(fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
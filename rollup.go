@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// rollupMarker namespaces per-directory rollup digest keys within an inputPrefix, the same way
+// generationMarker namespaces the per-input generation sentinel.
+const rollupMarker = "\x00rollup/"
+
+// rollupKey is the Badger key that stores the rollup digest for relDir, a slash-separated path
+// relative to inputDir ("" for inputDir's own root).
+func rollupKey(inputDir, relDir string) []byte {
+	return append(inputPrefix(inputDir), []byte(rollupMarker+relDir)...)
+}
+
+// subtreeDirs returns every directory containing relPath, from its immediate parent up to and
+// including inputDir's own root (""), so a file's rollup digest rolls up into every level of the
+// tree above it, not just the one directory it's directly in.
+func subtreeDirs(relPath string) []string {
+	var dirs []string
+	dir := filepath.ToSlash(filepath.Dir(relPath))
+	for {
+		if dir == "." {
+			dir = ""
+		}
+		dirs = append(dirs, dir)
+		if dir == "" {
+			return dirs
+		}
+		dir = filepath.ToSlash(filepath.Dir(dir))
+	}
+}
+
+// rollupDigest combines the fingerprints of every file under a directory (direct and nested)
+// into one stable value: sort by relative path, then hash each path alongside its content digest
+// (falling back to size and mtime for a digest-less detector like SizeOnly) in that order. Sorting
+// makes the result independent of scan order, so an unchanged subtree always rolls up to the same
+// digest, the property a recursive/"wildcard" change check depends on.
+func rollupDigest(entries map[string]FileFingerprint) []byte {
+	relPaths := make([]string, 0, len(entries))
+	for relPath := range entries {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+
+	h := sha256.New()
+	for _, relPath := range relPaths {
+		fp := entries[relPath]
+		fmt.Fprintf(h, "%s\x00", relPath)
+		if len(fp.Digest) > 0 {
+			h.Write(fp.Digest)
+		} else {
+			fmt.Fprintf(h, "%d\x00%d", fp.Size, fp.ModTime)
+		}
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil)
+}
+
+// storeRollups recomputes and persists the rollup digest for every directory level under
+// inputDir, from the fingerprints scanAndCompare just committed to DB. It runs after
+// commitFingerprints and sweepDeleted, and only folds in entries whose Gen equals currentGen —
+// i.e. files confirmed present this scan — so a deleted file (whether its stale DB entry was
+// already removed by a mirror sweep, or deliberately left behind by a non-mirror one) is excluded
+// either way. A directory that no longer has any live file under it has its rollup key deleted
+// rather than left stale. This rereads every entry under inputDir's prefix on every write scan,
+// trading O(tree size) work per scan for simplicity; an incremental rollup is future work if that
+// cost matters for very large trees.
+func (s *Scanner) storeRollups(inputDir string, currentGen uint64) error {
+	prefix := inputPrefix(inputDir)
+	rollupPrefix := append(append([]byte{}, prefix...), []byte(rollupMarker)...)
+
+	byDir := make(map[string]map[string]FileFingerprint)
+	staleDirs := make(map[string]bool)
+	err := s.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			if bytes.HasPrefix(key, rollupPrefix) {
+				staleDirs[string(key[len(rollupPrefix):])] = true
+				continue
+			}
+			if !isFileEntryKey(key, prefix) {
+				continue // some other sentinel, e.g. generationKey
+			}
+			relPath := string(key[len(prefix):])
+
+			var fp FileFingerprint
+			if err := item.Value(func(val []byte) error {
+				return fp.UnmarshalBinary(val)
+			}); err != nil {
+				// Same tolerance as processFile and sweepDeleted: an undecodable entry degrades
+				// to skipped rather than failing the rollup.
+				continue
+			}
+			if fp.Gen != currentGen {
+				// Stale entry for a file this scan no longer found (a non-mirror deletion leaves
+				// these in place deliberately); it must not count toward any rollup.
+				continue
+			}
+
+			for _, dir := range subtreeDirs(relPath) {
+				if byDir[dir] == nil {
+					byDir[dir] = make(map[string]FileFingerprint)
+				}
+				byDir[dir][relPath] = fp
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read fingerprints for rollup digest of '%s': %w", inputDir, err)
+	}
+
+	wb := s.DB.NewWriteBatch()
+	defer func() { wb.Cancel() }()
+	for dir, entries := range byDir {
+		if err := wb.Set(rollupKey(inputDir, dir), rollupDigest(entries)); err != nil {
+			return fmt.Errorf("failed to stage rollup digest for commit: %w", err)
+		}
+		delete(staleDirs, dir)
+	}
+	for dir := range staleDirs {
+		if err := wb.Delete(rollupKey(inputDir, dir)); err != nil {
+			return fmt.Errorf("failed to stage stale rollup digest for deletion: %w", err)
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return fmt.Errorf("failed to commit rollup digests: %w", err)
+	}
+	return s.DB.Sync()
+}
+
+// loadRollup returns the last-recorded rollup digest for relDir under inputDir, or nil if none
+// has been computed yet.
+func loadRollup(db *badger.DB, inputDir, relDir string) ([]byte, error) {
+	var digest []byte
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(rollupKey(inputDir, relDir))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			digest = append([]byte(nil), val...)
+			return nil
+		})
+	})
+	return digest, err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubtreeDirs(t *testing.T) {
+	assert.Equal(t, []string{""}, subtreeDirs("a.txt"))
+	assert.Equal(t, []string{"a", ""}, subtreeDirs("a/b.txt"))
+	assert.Equal(t, []string{"a/b", "a", ""}, subtreeDirs("a/b/c.txt"))
+}
+
+func TestRollupDigestStableAcrossOrderAndDeterministicOnContent(t *testing.T) {
+	entries := map[string]FileFingerprint{
+		"a.txt": {Size: 1, Digest: []byte{0x01}},
+		"b.txt": {Size: 2, Digest: []byte{0x02}},
+	}
+
+	first := rollupDigest(entries)
+	second := rollupDigest(entries)
+	assert.Equal(t, first, second, "hashing the same entries twice must produce the same digest")
+
+	changed := map[string]FileFingerprint{
+		"a.txt": {Size: 1, Digest: []byte{0x01}},
+		"b.txt": {Size: 3, Digest: []byte{0x03}},
+	}
+	assert.NotEqual(t, first, rollupDigest(changed), "a changed file's fingerprint must change the rollup digest")
+}
+
+func TestStoreRollupsRecordsEveryDirectoryLevel(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "root.txt"), []byte("a"), 0o644))
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "sub", "nested.txt"), []byte("b"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	rootDigest, err := loadRollup(scanner.DB, inputDir, "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, rootDigest, "the input directory's own rollup digest should be recorded")
+
+	subDigest, err := loadRollup(scanner.DB, inputDir, "sub")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, subDigest, "a nested directory's rollup digest should be recorded too")
+	assert.NotEqual(t, rootDigest, subDigest, "the root rolls up more files than the subdirectory, so they must differ")
+}
+
+func TestStoreRollupsChangesWhenAFileUnderneathChanges(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	path := filepath.Join(inputDir, "a.txt")
+	assert.NoError(t, afero.WriteFile(fs, path, []byte("hello"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+	before, err := loadRollup(scanner.DB, inputDir, "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, afero.WriteFile(fs, path, []byte("hello!!"), 0o644))
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+	after, err := loadRollup(scanner.DB, inputDir, "")
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, before, after, "editing a file should change its directory's rollup digest")
+}
+
+func TestStoreRollupsPrunesDirectoryEmptiedUnderMirror(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "root.txt"), []byte("a"), 0o644))
+	nestedPath := filepath.Join(inputDir, "sub", "nested.txt")
+	assert.NoError(t, afero.WriteFile(fs, nestedPath, []byte("b"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+	subDigest, err := loadRollup(scanner.DB, inputDir, "sub")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, subDigest)
+
+	assert.NoError(t, fs.Remove(nestedPath))
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, true, SizeOnly{}, 2))
+
+	subDigest, err = loadRollup(scanner.DB, inputDir, "sub")
+	assert.NoError(t, err)
+	assert.Nil(t, subDigest, "a directory with no live files left under it must not keep a stale rollup digest")
+}
+
+func TestStoreRollupsExcludesFileLeftStaleByNonMirrorDeletion(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	keepPath := filepath.Join(inputDir, "keep.txt")
+	gonePath := filepath.Join(inputDir, "gone.txt")
+	assert.NoError(t, afero.WriteFile(fs, keepPath, []byte("a"), 0o644))
+	assert.NoError(t, afero.WriteFile(fs, gonePath, []byte("b"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+	before, err := loadRollup(scanner.DB, inputDir, "")
+	assert.NoError(t, err)
+
+	// Without --mirror, sweepDeleted deliberately leaves gone.txt's database entry in place.
+	assert.NoError(t, fs.Remove(gonePath))
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+	after, err := loadRollup(scanner.DB, inputDir, "")
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, before, after, "the root rollup must reflect gone.txt's removal even though its stale DB entry is still there")
+}
+
+func TestStoreRollupsSkippedOnDryRun(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "a.txt"), []byte("hello"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, true, false, SizeOnly{}, 2))
+
+	digest, err := loadRollup(scanner.DB, inputDir, "")
+	assert.NoError(t, err)
+	assert.Nil(t, digest, "a dry run must not persist a rollup digest any more than it persists other DB mutations")
+}
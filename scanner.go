@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/spf13/afero"
+)
+
+// Scanner walks SrcFs for new and changed files, recording their fingerprints in DB and copying
+// them into DstFs. Keeping the filesystems behind afero.Fs lets tests run against an in-memory
+// filesystem and lets a future CLI point SrcFs/DstFs at remote backends (SFTP, S3, GCS) without
+// touching the diff logic below.
+type Scanner struct {
+	SrcFs afero.Fs
+	DstFs afero.Fs
+	DB    *badger.DB
+	// Manifest, if non-nil, records every New/Updated/Deleted entry observed during a scan.
+	Manifest *ManifestWriter
+	// Progress, if non-nil, is fed scan/copy counters for a live --progress display.
+	Progress *ProgressReporter
+	// Copy controls how copyFile places bytes at the destination (atomic rename, hardlink,
+	// attribute preservation).
+	Copy CopyOptions
+}
+
+// commitEntry is one fingerprint write waiting to land in DB, queued by a worker and applied by
+// the committer goroutine in scanAndCompare.
+type commitEntry struct {
+	key  []byte
+	data []byte
+}
+
+// commitBatchSize bounds how many commitEntry values the committer stages in a single
+// badger.WriteBatch before flushing, so a large scan doesn't hold an unbounded transaction open.
+const commitBatchSize = 1000
+
+// scanAndCompare walks inputDir on SrcFs with a producer/worker-pool pipeline: one goroutine
+// walks the tree and feeds a bounded jobs channel, N worker goroutines (workers) fingerprint and
+// copy changed files concurrently, and a single committer batches their fingerprint writes into
+// badger.WriteBatch transactions of commitBatchSize, fsyncing each batch before the next is
+// staged. When writeFlag is set, files no longer present under inputDir are reported as deleted,
+// and, under mirror, removed from DstFs and from DB; see sweepDeleted. Afterward, a per-directory
+// rollup digest is recomputed for every directory level under inputDir from the now-current
+// fingerprints; see storeRollups.
+func (s *Scanner) scanAndCompare(inputDir, outputDir string, writeFlag, dryRun, mirror bool, detector ChangeDetector, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	prevGen, err := loadGeneration(s.DB, inputDir)
+	if err != nil {
+		return fmt.Errorf("failed to load scan generation for '%s': %w", inputDir, err)
+	}
+	currentGen := prevGen + 1
+
+	type job struct {
+		path string
+		info os.FileInfo
+	}
+
+	jobs := make(chan job, workers)
+	commits := make(chan commitEntry, workers)
+
+	var mu sync.Mutex
+	var firstErr error
+	recordErr := func(err error) {
+		if err == nil {
+			return
+		}
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				recordErr(s.processFile(j.path, j.info, inputDir, outputDir, currentGen, writeFlag, dryRun, detector, commits))
+			}
+		}()
+	}
+
+	walkDone := make(chan error, 1)
+	go func() {
+		walkDone <- afero.Walk(s.SrcFs, inputDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			jobs <- job{path: path, info: info}
+			s.Progress.addScanned(1)
+			return nil
+		})
+		close(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(commits)
+	}()
+
+	recordErr(s.commitFingerprints(commits, writeFlag))
+
+	if err := <-walkDone; err != nil {
+		recordErr(err)
+	}
+
+	if writeFlag && firstErr == nil {
+		if err := s.DB.Update(func(txn *badger.Txn) error {
+			return storeGeneration(txn, inputDir, currentGen)
+		}); err != nil {
+			return fmt.Errorf("failed to persist scan generation for '%s': %w", inputDir, err)
+		}
+		if err := s.sweepDeleted(inputDir, outputDir, currentGen, mirror, dryRun); err != nil {
+			firstErr = err
+		}
+		if firstErr == nil && !dryRun {
+			if err := s.storeRollups(inputDir, currentGen); err != nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// processFile fingerprints path, compares it against the entry DB already holds for it, copies
+// it to outputDir when new or changed, and, if writeFlag is set, queues the refreshed fingerprint
+// on commits for the committer to persist. It runs concurrently across scanAndCompare's worker
+// pool, so it only ever reads DB directly; all writes go through commits.
+func (s *Scanner) processFile(path string, info os.FileInfo, inputDir, outputDir string, currentGen uint64, writeFlag, dryRun bool, detector ChangeDetector, commits chan<- commitEntry) error {
+	fp, err := detector.Fingerprint(s.SrcFs, path, info)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint file '%s': %w", path, err)
+	}
+	fp.Gen = currentGen
+
+	key, err := dbKey(inputDir, path)
+	if err != nil {
+		return err
+	}
+
+	var prev FileFingerprint
+	found := false
+	err = s.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := item.Value(func(val []byte) error {
+			return prev.UnmarshalBinary(val)
+		}); err != nil {
+			// The stored value isn't a fingerprint we can decode: either a pre-fingerprint
+			// baseline entry (a raw size, not gob) or a corrupt/partial write. DB is derivable
+			// cache state, so treat it as absent and re-fingerprint rather than failing the scan.
+			return nil
+		}
+		found = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to look up database entry for '%s': %w", path, err)
+	}
+
+	changed := !found || detector.Changed(prev, fp)
+	switch {
+	case !found:
+		fmt.Println("New:", path)
+		s.Manifest.Record(newManifestEntry(ManifestNew, path, fp))
+	case changed:
+		fmt.Println("Updated:", path)
+		s.Manifest.Record(newManifestEntry(ManifestUpdated, path, fp))
+	}
+
+	if changed && !dryRun {
+		if err := s.copyFileToOutput(path, inputDir, outputDir); err != nil {
+			return err
+		}
+		s.Progress.addCopied(fp.Size)
+	}
+
+	if writeFlag {
+		data, err := fp.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("failed to encode fingerprint for '%s': %w", path, err)
+		}
+		commits <- commitEntry{key: key, data: data}
+	}
+
+	return nil
+}
+
+// commitFingerprints is scanAndCompare's single committer: it drains commits, staging each entry
+// into a badger.WriteBatch and flushing (then fsyncing DB) every commitBatchSize entries so a
+// long scan never holds one unbounded transaction open. It returns once commits is closed, after
+// every committed entry has been fsynced.
+func (s *Scanner) commitFingerprints(commits <-chan commitEntry, writeFlag bool) error {
+	if !writeFlag {
+		for range commits {
+		}
+		return nil
+	}
+
+	wb := s.DB.NewWriteBatch()
+	defer func() { wb.Cancel() }()
+
+	pending := 0
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+		if err := wb.Flush(); err != nil {
+			return fmt.Errorf("failed to commit fingerprint batch: %w", err)
+		}
+		if err := s.DB.Sync(); err != nil {
+			return fmt.Errorf("failed to sync fingerprint batch: %w", err)
+		}
+		wb = s.DB.NewWriteBatch()
+		pending = 0
+		return nil
+	}
+
+	for entry := range commits {
+		if err := wb.Set(entry.key, entry.data); err != nil {
+			return fmt.Errorf("failed to stage fingerprint for commit: %w", err)
+		}
+		pending++
+		if pending >= commitBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// copyFileToOutput copies a file from the input directory on SrcFs to the output directory on DstFs
+func (s *Scanner) copyFileToOutput(path, inputDir, outputDir string) error {
+	relPath, err := filepath.Rel(inputDir, path)
+	if err != nil {
+		return fmt.Errorf("failed to get relative path for file '%s': %w", path, err)
+	}
+	destPath := filepath.Join(outputDir, relPath)
+	if err := s.DstFs.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create output directory for file '%s': %w", path, err)
+	}
+	return s.copyFile(path, destPath)
+}
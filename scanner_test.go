@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScanAndCompareCommitsAcrossMultipleBatches exercises the committer's batching path by
+// scanning more files than commitBatchSize, with a worker pool smaller than the file count, and
+// checks every fingerprint still lands in DB.
+func TestScanAndCompareCommitsAcrossMultipleBatches(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+
+	const numFiles = commitBatchSize + 50
+	for i := 0; i < numFiles; i++ {
+		path := filepath.Join(inputDir, fmt.Sprintf("file-%d.txt", i))
+		assert.NoError(t, afero.WriteFile(fs, path, []byte(fmt.Sprintf("content-%d", i)), 0o644))
+	}
+
+	scanner := newTestScanner(t, fs)
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 8))
+
+	for i := 0; i < numFiles; i++ {
+		exists, err := afero.Exists(fs, filepath.Join(outputDir, fmt.Sprintf("file-%d.txt", i)))
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	}
+
+	// A second scan should find every file already fingerprinted and copy nothing new.
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 8))
+}
+
+// TestProcessFileTreatsUndecodableEntryAsNew covers upgrading from a baseline DB (raw 8-byte
+// sizes, not gob) and recovering from a corrupt entry: either way, UnmarshalBinary fails, and
+// that must degrade to a fresh fingerprint rather than aborting the scan.
+func TestProcessFileTreatsUndecodableEntryAsNew(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	path := filepath.Join(inputDir, "a.txt")
+	assert.NoError(t, afero.WriteFile(fs, path, []byte("hello"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	key, err := dbKey(inputDir, path)
+	assert.NoError(t, err)
+	assert.NoError(t, scanner.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, []byte{0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	}))
+
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	exists, err := afero.Exists(fs, filepath.Join(outputDir, "a.txt"))
+	assert.NoError(t, err)
+	assert.True(t, exists, "an undecodable entry should be re-fingerprinted and copied like a new file")
+}
+
+func TestProgressReporterTracksScannedAndCopied(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	inputDir, outputDir := "/input", "/output"
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "a.txt"), []byte("hello"), 0o644))
+	assert.NoError(t, afero.WriteFile(fs, filepath.Join(inputDir, "b.txt"), []byte("world!"), 0o644))
+
+	scanner := newTestScanner(t, fs)
+	reporter := NewProgressReporter(0, 0)
+	scanner.Progress = reporter
+
+	assert.NoError(t, scanner.scanAndCompare(inputDir, outputDir, true, false, false, SizeOnly{}, 2))
+
+	assert.EqualValues(t, 2, reporter.scanned)
+	assert.EqualValues(t, 2, reporter.copied)
+	assert.EqualValues(t, 11, reporter.bytes)
+}